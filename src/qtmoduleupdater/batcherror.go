@@ -0,0 +1,74 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BatchError aggregates the per-module failures encountered while scheduling updates for a batch,
+// so that one bad module does not abort progress on the rest of Todo.
+type BatchError struct {
+	// Failures maps a module's RepoPath to the error encountered while updating it.
+	Failures map[string]error
+}
+
+func newBatchError() *BatchError {
+	return &BatchError{Failures: make(map[string]error)}
+}
+
+// Add records err as the failure for repoPath.
+func (e *BatchError) Add(repoPath string, err error) {
+	e.Failures[repoPath] = err
+}
+
+// orNil returns e as an error if it holds any failures, or nil otherwise, so callers can return
+// the result of a batch run directly without checking len(e.Failures) themselves.
+func (e *BatchError) orNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	repoPaths := make([]string, 0, len(e.Failures))
+	for repoPath := range e.Failures {
+		repoPaths = append(repoPaths, repoPath)
+	}
+	sort.Strings(repoPaths)
+
+	lines := make([]string, 0, len(repoPaths))
+	for _, repoPath := range repoPaths {
+		lines = append(lines, fmt.Sprintf("%s: %s", repoPath, e.Failures[repoPath]))
+	}
+
+	return fmt.Sprintf("%d module(s) failed to update:\n%s", len(e.Failures), strings.Join(lines, "\n"))
+}
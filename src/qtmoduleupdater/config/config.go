@@ -0,0 +1,172 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+
+// Package config loads the YAML configuration used to parameterize a qtmoduleupdater batch run:
+// the product/branch list to process, Gerrit credentials, per-module push/review policy, and the
+// module special-casing that used to be hardcoded in the batch scheduling logic.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ModuleRule describes how a single module should be special-cased when building the batch's
+// todo/done lists, overriding the default scheme-based scheduling.
+type ModuleRule struct {
+	// ForceDone marks the module as already up-to-date, excluding it from the todo list.
+	ForceDone bool `yaml:"forceDone"`
+	// ForceTodo marks the module for update even if it would otherwise be skipped (e.g. a
+	// "master" branched module).
+	ForceTodo bool `yaml:"forceTodo"`
+	// Ignore excludes the module from both the todo and done lists entirely.
+	Ignore bool `yaml:"ignore"`
+	// Reviewers overrides the default reviewer list for changes pushed against this module.
+	Reviewers []string `yaml:"reviewers"`
+}
+
+// Retry describes the backoff policy applied to transient Gerrit failures.
+type Retry struct {
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoffSeconds is how long a module's next status check waits after its first retry
+	// is pushed; the wait after each later retry doubles from this value.
+	InitialBackoffSeconds int `yaml:"initialBackoffSeconds"`
+	// TimeoutSeconds bounds how long a single pending-module status check may take.
+	TimeoutSeconds int `yaml:"timeoutSeconds"`
+}
+
+// ProductBranch names one product/branch pair to run a batch update for.
+type ProductBranch struct {
+	Product string `yaml:"product"`
+	Branch  string `yaml:"branch"`
+}
+
+// ModuleEntry names a single module for the explicit-list DependencySource, for downstream
+// products that don't have a qt5-style supermodule to enumerate modules from.
+type ModuleEntry struct {
+	Name string `yaml:"name"`
+	// Branch overrides the batch's target branch for this module if set.
+	Branch string `yaml:"branch"`
+	// RepoType mirrors the qt5 .gitmodules "type" entry (e.g. "inherited"); modules of this type
+	// are treated as already up-to-date.
+	RepoType string `yaml:"repoType"`
+}
+
+// Config is the top-level shape of config.yaml.
+type Config struct {
+	Runs []ProductBranch `yaml:"runs"`
+
+	GerritURL        string   `yaml:"gerritUrl"`
+	PushUser         string   `yaml:"pushUser"`
+	DefaultReviewers []string `yaml:"defaultReviewers"`
+
+	// ModuleRules maps a module's RepoPath (e.g. "qt/qtbase") to its special-casing.
+	ModuleRules map[string]ModuleRule `yaml:"moduleRules"`
+
+	// SkipBranches lists submodule branch names that never need a dependencies.yaml update,
+	// matching the historical "master" skip in loadTodoAndDoneModuleMapFromSubModules.
+	SkipBranches []string `yaml:"skipBranches"`
+
+	// ExplicitModules, when non-empty, makes the batch resolve its module list from this fixed
+	// set instead of fetching qt/qt5.git's .gitmodules.
+	ExplicitModules []ModuleEntry `yaml:"explicitModules"`
+
+	Retry Retry `yaml:"retry"`
+}
+
+// defaultConfig mirrors the behavior ModuleUpdateBatch had before config.yaml existed, so a batch
+// run without a config file keeps working exactly as it did.
+func defaultConfig() *Config {
+	return &Config{
+		SkipBranches: []string{"master"},
+		ModuleRules: map[string]ModuleRule{
+			"qt/qtbase": {ForceDone: true},
+		},
+		// MaxAttempts: 0 preserves the pre-retry behavior of giving up on a module the first
+		// time its integration fails; operators opt into retries explicitly via config.yaml.
+		Retry: Retry{
+			MaxAttempts:           0,
+			InitialBackoffSeconds: 0,
+			TimeoutSeconds:        0,
+		},
+	}
+}
+
+// Load reads and parses the config.yaml at path, filling in any field left unset with the
+// backward-compatible defaults described by defaultConfig. A missing config file is not an
+// error: it means the batch run keeps working exactly as it did before config.yaml existed, so
+// Load returns defaultConfig() unchanged.
+func Load(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file %s: %s", path, err)
+	}
+
+	if err = yaml.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+
+	if len(cfg.SkipBranches) == 0 {
+		cfg.SkipBranches = defaultConfig().SkipBranches
+	}
+
+	return cfg, nil
+}
+
+// IsSkippedBranch reports whether submodule entries on branch should be excluded from the
+// todo/done lists entirely, e.g. the historical "master" skip.
+func (c *Config) IsSkippedBranch(branch string) bool {
+	for _, skip := range c.SkipBranches {
+		if skip == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleFor returns the configured ModuleRule for repoPath, or the zero value if none is configured.
+func (c *Config) RuleFor(repoPath string) ModuleRule {
+	return c.ModuleRules[repoPath]
+}
+
+// ReviewersFor returns the reviewer list to use for changes against repoPath, falling back to
+// DefaultReviewers when the module has none configured.
+func (c *Config) ReviewersFor(repoPath string) []string {
+	if rule, ok := c.ModuleRules[repoPath]; ok && len(rule.Reviewers) > 0 {
+		return rule.Reviewers
+	}
+	return c.DefaultReviewers
+}
@@ -0,0 +1,82 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+package main
+
+import (
+	"fmt"
+
+	"qtmoduleupdater/config"
+)
+
+// DependencySource lists the submodules a batch run should consider for product at branch,
+// resolved against ref. ModuleUpdateBatch.loadTodoList is parameterized by a DependencySource
+// rather than hardcoding the qt5 .gitmodules fetch, so other ways of enumerating a product's
+// modules can be added without touching the batch scheduling logic.
+type DependencySource interface {
+	ListModules(product, branch, ref string) (map[string]*submodule, error)
+}
+
+// qt5SupermoduleSource lists modules the way ModuleUpdateBatch always has: from qt/qt5.git's
+// .gitmodules at the given product and branch.
+type qt5SupermoduleSource struct{}
+
+func (qt5SupermoduleSource) ListModules(product, branch, ref string) (map[string]*submodule, error) {
+	return getQt5ProductModules(product, branch, ref)
+}
+
+// explicitListSource lists modules from the fixed set configured in config.yaml's
+// explicitModules, for downstream products that don't have a qt5-style supermodule to enumerate
+// modules from.
+type explicitListSource struct {
+	cfg *config.Config
+}
+
+func (s explicitListSource) ListModules(product, branch, ref string) (map[string]*submodule, error) {
+	if len(s.cfg.ExplicitModules) == 0 {
+		return nil, fmt.Errorf("config.yaml has no explicitModules entries for product %s", product)
+	}
+
+	submodules := make(map[string]*submodule)
+	for _, entry := range s.cfg.ExplicitModules {
+		entryBranch := entry.Branch
+		if entryBranch == "" {
+			entryBranch = branch
+		}
+		submodules[entry.Name] = &submodule{branch: entryBranch, repoType: entry.RepoType}
+	}
+	return submodules, nil
+}
+
+// NewDependencySource picks the DependencySource a batch run should use: the explicit list from
+// config.yaml when one is configured, otherwise the qt5 supermodule's .gitmodules.
+func NewDependencySource(cfg *config.Config) DependencySource {
+	if cfg != nil && len(cfg.ExplicitModules) > 0 {
+		return explicitListSource{cfg: cfg}
+	}
+	return qt5SupermoduleSource{}
+}
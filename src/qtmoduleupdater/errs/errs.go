@@ -0,0 +1,65 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+
+// Package errs provides a structured error type for qtmoduleupdater that carries, alongside the
+// underlying cause, the task that was being attempted and an actionable hint for an operator,
+// so failures surfaced by printSummary point at the next step instead of requiring a log dive.
+package errs
+
+import "fmt"
+
+// Error wraps cause with the task being attempted and, where known, a hint describing how an
+// operator can remediate it.
+type Error struct {
+	Task  string
+	Cause error
+	Hint  string
+}
+
+// New returns an Error for task, wrapping cause with hint.
+func New(task string, cause error, hint string) *Error {
+	return &Error{Task: task, Cause: cause, Hint: hint}
+}
+
+func (e *Error) Error() string {
+	if e.Hint == "" {
+		return e.Message()
+	}
+	return fmt.Sprintf("%s (hint: %s)", e.Message(), e.Hint)
+}
+
+// Message returns the task/cause text without the hint, for callers that render the hint
+// separately from the error message (e.g. printFailedModules).
+func (e *Error) Message() string {
+	return fmt.Sprintf("%s: %s", e.Task, e.Cause)
+}
+
+// Unwrap allows errors.As/errors.Is to see through an Error to its Cause.
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,110 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+package main
+
+import (
+	"flag"
+	"log"
+
+	"qtmoduleupdater/config"
+)
+
+func main() {
+	product := flag.String("product", "", "qt5 product to batch-update (e.g. qt/qt5); ignored when -module is given")
+	branch := flag.String("branch", "", "target branch to bring dependencies.yaml up-to-date on")
+	module := flag.String("module", "", "run in standalone mode for a single repo path (e.g. qt/qtbase) instead of a qt5 product batch")
+	productRef := flag.String("product-ref", "", "resolve dependencies against qt/qt5.git at this ref instead of the current HEADs of each dependency (standalone mode) or the tip of branch (batch mode)")
+	configPath := flag.String("config", "config.yaml", "path to the batch config.yaml")
+	pushUser := flag.String("push-user", "", "Gerrit user to push changes as; defaults to the config.yaml pushUser")
+	manualStage := flag.Bool("manual-stage", false, "push changes but do not automatically stage them")
+	dryRun := flag.Bool("dry-run", false, "standalone -module mode only: print the proposed dependencies.yaml diff and commit message instead of pushing to Gerrit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("could not load config %s: %s", *configPath, err)
+	}
+
+	pushUserName := *pushUser
+	if pushUserName == "" {
+		pushUserName = cfg.PushUser
+	}
+
+	if *module != "" {
+		if *branch == "" {
+			log.Fatal("-branch is required together with -module")
+		}
+		if err = UpdateSingleModule(*module, *branch, *productRef, pushUserName, *manualStage, *dryRun, cfg); err != nil {
+			log.Fatalf("standalone update of %s failed: %s", *module, err)
+		}
+		return
+	}
+
+	if *dryRun {
+		log.Fatal("-dry-run is only supported together with -module")
+	}
+	if *product == "" || *branch == "" {
+		log.Fatal("-product and -branch are required unless -module is given")
+	}
+
+	runBatch(*product, *branch, *productRef, pushUserName, *manualStage, cfg)
+}
+
+// runBatch drives a single tick of a qt5-product-wide ModuleUpdateBatch: resume the todo/pending
+// state saved by a previous invocation (or build a fresh one via the configured
+// DependencySource), schedule any updates that are now ready, poll previously pending ones, print
+// the summary, and persist state for the next invocation unless the batch has finished. Like
+// checkPendingModules's retry backoff, driving the batch to completion is expected to happen
+// across repeated invocations (e.g. from cron) rather than in a single long-running process.
+func runBatch(product, branch, productRef, pushUserName string, manualStage bool, cfg *config.Config) {
+	batch := &ModuleUpdateBatch{Product: product, Branch: branch}
+
+	if err := batch.loadState(); err != nil {
+		source := NewDependencySource(cfg)
+		if err := batch.loadTodoList(source, productRef, cfg); err != nil {
+			log.Fatalf("could not load todo list for %s: %s", product, err)
+		}
+	}
+
+	if err := batch.scheduleUpdates(pushUserName, manualStage, cfg); err != nil {
+		log.Printf("scheduleUpdates reported failures: %s\n", err)
+	}
+
+	batch.checkPendingModules(cfg, pushUserName, manualStage)
+
+	batch.printSummary()
+
+	if batch.isDone() {
+		batch.clearState()
+		return
+	}
+
+	if err := batch.saveState(); err != nil {
+		log.Printf("could not save state: %s\n", err)
+	}
+}
@@ -29,10 +29,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strings"
+	"time"
+
+	"qtmoduleupdater/config"
+	"qtmoduleupdater/errs"
 )
 
 // PendingUpdate describes that a module needs an updated dependencies.yaml and we are waiting for the change
@@ -40,6 +46,15 @@ import (
 type PendingUpdate struct {
 	Module   *Module
 	ChangeID string
+
+	// Attempts counts how many times an integration of this module has failed and been retried.
+	Attempts int
+	// LastError holds the reason the most recent attempt failed, for diagnostics in the saved
+	// state.
+	LastError string
+	// NextRetryTime is when checkPendingModules may next retry this module, implementing the
+	// exponential backoff between attempts.
+	NextRetryTime time.Time
 }
 
 // ModuleUpdateBatch is used to serialize and de-serialize the module updating state, used for debugging.
@@ -50,13 +65,59 @@ type ModuleUpdateBatch struct {
 	Done              map[string]*Module
 	Pending           []*PendingUpdate
 	FailedModuleCount int
+	// FailedModules records the error string for each module scheduleUpdates gave up on, keyed
+	// by RepoPath, so a subsequent run started from the saved state can inspect or retry them.
+	FailedModules map[string]string
+	// FailedModuleHints records the actionable remediation hint for each entry in FailedModules,
+	// when the underlying error provided one.
+	FailedModuleHints map[string]string
+}
+
+// recordModuleFailure marks repoPath as failed with cause in the persisted state and removes any
+// module left in Todo that directly or indirectly depends on it. When cause carries an
+// errs.Error hint, it is persisted separately so printSummary can render it beneath that
+// module's entry in the failed-module list.
+func (batch *ModuleUpdateBatch) recordModuleFailure(repoPath string, cause error) {
+	if batch.FailedModules == nil {
+		batch.FailedModules = make(map[string]string)
+	}
+
+	var structured *errs.Error
+	if errors.As(cause, &structured) {
+		// Store the bare task/cause text here; the hint is recorded separately in
+		// FailedModuleHints so printFailedModules doesn't render it twice.
+		batch.FailedModules[repoPath] = structured.Message()
+		if structured.Hint != "" {
+			if batch.FailedModuleHints == nil {
+				batch.FailedModuleHints = make(map[string]string)
+			}
+			batch.FailedModuleHints[repoPath] = structured.Hint
+		}
+	} else {
+		batch.FailedModules[repoPath] = cause.Error()
+	}
+
+	batch.FailedModuleCount++
+	removeAllDirectAndIndirectDependencies(&batch.Todo, repoPath)
 }
 
-func (batch *ModuleUpdateBatch) scheduleUpdates(pushUserName string, manualStage bool) error {
+// failModule records err as moduleToUpdate's failure in batchErr and in the persisted state, and
+// removes the module (and anything depending on it) from Todo the same way checkPendingModules
+// does for a module whose change was abandoned in Gerrit.
+func (batch *ModuleUpdateBatch) failModule(moduleToUpdate *Module, batchErr *BatchError, err error) {
+	batchErr.Add(moduleToUpdate.RepoPath, err)
+	delete(batch.Todo, moduleToUpdate.RepoPath)
+	batch.recordModuleFailure(moduleToUpdate.RepoPath, err)
+}
+
+func (batch *ModuleUpdateBatch) scheduleUpdates(pushUserName string, manualStage bool, cfg *config.Config) error {
+	batchErr := newBatchError()
+
 	for _, moduleToUpdate := range batch.Todo {
 		update, err := moduleToUpdate.updateDependenciesForModule(batch.Done)
 		if err != nil {
-			return fmt.Errorf("fatal error proposing module update: %s", err)
+			batch.failModule(moduleToUpdate, batchErr, fmt.Errorf("error proposing module update: %s", err))
+			continue
 		}
 		log.Printf("Attempting update for module %s resulted in %v\n", moduleToUpdate.RepoPath, update.result)
 		if update.result == DependenciesUpdateContentUpToDate {
@@ -67,23 +128,29 @@ func (batch *ModuleUpdateBatch) scheduleUpdates(pushUserName string, manualStage
 		} else if update.result == DependenciesUpdateUpdateScheduled {
 			// push and stage
 			if err = pushChange(moduleToUpdate.RepoPath, moduleToUpdate.Branch, update.commitID, update.summary, pushUserName); err != nil {
-				return fmt.Errorf("error pushing change upate: %s", err)
+				batch.failModule(moduleToUpdate, batchErr, errs.New(
+					fmt.Sprintf("push update for %s", moduleToUpdate.RepoPath),
+					err,
+					fmt.Sprintf("check that %s has push permission for %s on branch %s", pushUserName, moduleToUpdate.RepoPath, moduleToUpdate.Branch),
+				))
+				continue
 			}
 
 			if !manualStage {
-				if err = reviewAndStageChange(moduleToUpdate.RepoPath, moduleToUpdate.Branch, update.commitID, update.summary); err != nil {
-					return fmt.Errorf("error pushing change upate: %s", err)
+				if err = reviewAndStageChange(moduleToUpdate.RepoPath, moduleToUpdate.Branch, update.commitID, update.summary, cfg.ReviewersFor(moduleToUpdate.RepoPath)); err != nil {
+					batch.failModule(moduleToUpdate, batchErr, fmt.Errorf("error pushing change upate: %s", err))
+					continue
 				}
 			}
 
-			batch.Pending = append(batch.Pending, &PendingUpdate{moduleToUpdate, update.changeID})
+			batch.Pending = append(batch.Pending, &PendingUpdate{Module: moduleToUpdate, ChangeID: update.changeID})
 			delete(batch.Todo, moduleToUpdate.RepoPath)
 		} else {
-			return fmt.Errorf("invalid state returned by updateDependenciesForModule for %s", moduleToUpdate.RepoPath)
+			batch.failModule(moduleToUpdate, batchErr, fmt.Errorf("invalid state returned by updateDependenciesForModule for %s", moduleToUpdate.RepoPath))
 		}
 	}
 
-	return nil
+	return batchErr.orNil()
 }
 
 func removeAllDirectAndIndirectDependencies(allModules *map[string]*Module, moduleToRemove string) {
@@ -95,12 +162,63 @@ func removeAllDirectAndIndirectDependencies(allModules *map[string]*Module, modu
 	}
 }
 
-func (batch *ModuleUpdateBatch) checkPendingModules() {
+// retryBackoff returns how long to wait after pushing retry number attempt (1-based) before
+// checking the module's status again, growing exponentially from retry.InitialBackoffSeconds.
+func retryBackoff(retry config.Retry, attempt int) time.Duration {
+	if retry.InitialBackoffSeconds <= 0 {
+		return 0
+	}
+	seconds := retry.InitialBackoffSeconds << uint(attempt-1)
+	return time.Duration(seconds) * time.Second
+}
+
+// statusCheckTimeout returns how long a single Gerrit change-status check may take before it is
+// treated as an error, per retry.TimeoutSeconds. Zero means no timeout is enforced.
+func statusCheckTimeout(retry config.Retry) time.Duration {
+	if retry.TimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(retry.TimeoutSeconds) * time.Second
+}
+
+// retryPendingUpdate regenerates module's dependencies.yaml against the current tips in batch.Done
+// and re-pushes it, replacing pendingUpdate.ChangeID with the new change.
+func (batch *ModuleUpdateBatch) retryPendingUpdate(pendingUpdate *PendingUpdate, pushUserName string, manualStage bool, cfg *config.Config) (*PendingUpdate, error) {
+	module := pendingUpdate.Module
+	update, err := module.updateDependenciesForModule(batch.Done)
+	if err != nil {
+		return nil, fmt.Errorf("error regenerating module update: %s", err)
+	}
+	if update.result != DependenciesUpdateUpdateScheduled {
+		return nil, fmt.Errorf("regenerated update for %s is no longer in a pushable state (%v)", module.RepoPath, update.result)
+	}
+
+	if err = pushChange(module.RepoPath, module.Branch, update.commitID, update.summary, pushUserName); err != nil {
+		return nil, fmt.Errorf("error pushing retried change update: %s", err)
+	}
+	if !manualStage {
+		if err = reviewAndStageChange(module.RepoPath, module.Branch, update.commitID, update.summary, cfg.ReviewersFor(module.RepoPath)); err != nil {
+			return nil, fmt.Errorf("error pushing retried change update: %s", err)
+		}
+	}
+
+	pendingUpdate.ChangeID = update.changeID
+	return pendingUpdate, nil
+}
+
+func (batch *ModuleUpdateBatch) checkPendingModules(cfg *config.Config, pushUserName string, manualStage bool) {
 	log.Println("Checking status of pending modules")
 	var newPending []*PendingUpdate
 	for _, pendingUpdate := range batch.Pending {
 		module := pendingUpdate.Module
-		status, err := getGerritChangeStatus(module.RepoPath, module.Branch, pendingUpdate.ChangeID)
+
+		if time.Now().Before(pendingUpdate.NextRetryTime) {
+			// Still backing off from a previous failed attempt.
+			newPending = append(newPending, pendingUpdate)
+			continue
+		}
+
+		status, err := getGerritChangeStatus(module.RepoPath, module.Branch, pendingUpdate.ChangeID, statusCheckTimeout(cfg.Retry))
 		if err != nil {
 			log.Printf("    status check of %s gave error: %s\n", module.RepoPath, err)
 		} else {
@@ -114,22 +232,60 @@ func (batch *ModuleUpdateBatch) checkPendingModules() {
 			module.refreshTip()
 			batch.Done[module.RepoPath] = module
 		} else {
-			// Open or abandoned, not sure -- either way an error integrating the update
-			removeAllDirectAndIndirectDependencies(&batch.Todo, module.RepoPath)
-			batch.FailedModuleCount++
+			// Open or abandoned: often a transient integration failure (flaky CI, a merge
+			// conflict resolvable by regenerating dependencies.yaml against a newer tip) rather
+			// than a hard failure, so retry a bounded number of times before giving up.
+			pendingUpdate.Attempts++
+			cause := errs.New(
+				fmt.Sprintf("integrate update for %s", module.RepoPath),
+				fmt.Errorf("change %s ended in status %s", pendingUpdate.ChangeID, status),
+				gerritChangeHint(cfg.GerritURL, pendingUpdate.ChangeID),
+			)
+			pendingUpdate.LastError = cause.Error()
+
+			if pendingUpdate.Attempts > cfg.Retry.MaxAttempts {
+				log.Printf("    giving up on %s after %d attempt(s): %s\n", module.RepoPath, pendingUpdate.Attempts, pendingUpdate.LastError)
+				batch.recordModuleFailure(module.RepoPath, cause)
+				continue
+			}
+
+			backoff := retryBackoff(cfg.Retry, pendingUpdate.Attempts)
+			log.Printf("    retrying %s (attempt %d/%d), next status check in %s\n", module.RepoPath, pendingUpdate.Attempts, cfg.Retry.MaxAttempts, backoff)
+
+			retried, err := batch.retryPendingUpdate(pendingUpdate, pushUserName, manualStage, cfg)
+			if err != nil {
+				log.Printf("    retry of %s could not be pushed, will try again: %s\n", module.RepoPath, err)
+				pendingUpdate.LastError = err.Error()
+				retried = pendingUpdate
+			}
+			retried.NextRetryTime = time.Now().Add(backoff)
+			newPending = append(newPending, retried)
 		}
 	}
 	batch.Pending = newPending
 }
 
-func loadTodoAndDoneModuleMapFromSubModules(branch string, submodules map[string]*submodule) (todo map[string]*Module, done map[string]*Module, err error) {
+// gerritChangeHint points an operator at the Gerrit change behind a failed integration.
+func gerritChangeHint(gerritURL, changeID string) string {
+	if gerritURL == "" {
+		return fmt.Sprintf("check Gerrit for change %s", changeID)
+	}
+	return fmt.Sprintf("review the abandoned/open change at %s/q/%s", strings.TrimRight(gerritURL, "/"), changeID)
+}
+
+func loadTodoAndDoneModuleMapFromSubModules(branch string, submodules map[string]*submodule, cfg *config.Config) (todo map[string]*Module, done map[string]*Module, err error) {
 	todoModules := make(map[string]*Module)
 	doneModules := make(map[string]*Module)
 
 	for name, submodule := range submodules {
+		rule := cfg.RuleFor(name)
+		if rule.Ignore {
+			continue
+		}
+
 		// Erase modules that don't follow the qt5 branching scheme and don't need
-		// dependencies.yaml
-		if submodule.branch == "master" {
+		// dependencies.yaml, unless config explicitly forces them into the todo list.
+		if cfg.IsSkippedBranch(submodule.branch) && !rule.ForceTodo {
 			continue
 		}
 
@@ -138,7 +294,7 @@ func loadTodoAndDoneModuleMapFromSubModules(branch string, submodules map[string
 			return nil, nil, fmt.Errorf("could not create internal module structure: %s", err)
 		}
 
-		if submodule.repoType == "inherited" || name == "qt/qtbase" {
+		if (submodule.repoType == "inherited" || rule.ForceDone) && !rule.ForceTodo {
 			doneModules[module.RepoPath] = module
 		} else {
 			todoModules[module.RepoPath] = module
@@ -148,13 +304,13 @@ func loadTodoAndDoneModuleMapFromSubModules(branch string, submodules map[string
 	return todoModules, doneModules, nil
 }
 
-func (batch *ModuleUpdateBatch) loadTodoList(qt5FetchRef string) error {
-	qt5Modules, err := getQt5ProductModules(batch.Product, batch.Branch, qt5FetchRef)
+func (batch *ModuleUpdateBatch) loadTodoList(source DependencySource, fetchRef string, cfg *config.Config) error {
+	modules, err := source.ListModules(batch.Product, batch.Branch, fetchRef)
 	if err != nil {
-		return fmt.Errorf("Error listing qt5 product modules: %s", err)
+		return fmt.Errorf("Error listing modules for %s: %s", batch.Product, err)
 	}
 
-	batch.Todo, batch.Done, err = loadTodoAndDoneModuleMapFromSubModules(batch.Branch, qt5Modules)
+	batch.Todo, batch.Done, err = loadTodoAndDoneModuleMapFromSubModules(batch.Branch, modules, cfg)
 	return err
 }
 
@@ -212,6 +368,7 @@ func (batch *ModuleUpdateBatch) printSummary() {
 	if batch.isDone() {
 		if batch.FailedModuleCount > 0 {
 			fmt.Fprintf(os.Stdout, "    %v modules failed to be updated. Check Gerrit for the %s branch\n", batch.FailedModuleCount, batch.Branch)
+			batch.printFailedModules()
 		} else {
 			fmt.Fprintf(os.Stdout, "    No updates are necessary for any modules - everything is up-to-date\n")
 		}
@@ -239,6 +396,26 @@ func (batch *ModuleUpdateBatch) printSummary() {
 		fmt.Println("    " + name)
 	}
 
+	if batch.FailedModuleCount > 0 {
+		fmt.Fprintf(os.Stdout, "The following modules failed to be updated and were dropped, along with their dependents:\n")
+		batch.printFailedModules()
+	}
+
 	fmt.Println()
 	fmt.Println()
-}
\ No newline at end of file
+}
+
+func (batch *ModuleUpdateBatch) printFailedModules() {
+	names := make([]string, 0, len(batch.FailedModules))
+	for name := range batch.FailedModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("    %s: %s\n", name, batch.FailedModules[name])
+		if hint, ok := batch.FailedModuleHints[name]; ok {
+			fmt.Printf("        hint: %s\n", hint)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+/****************************************************************************
+**
+** Copyright (C) 2016 The Qt Company Ltd.
+** Contact: https://www.qt.io/licensing/
+**
+** This file is part of the repo tools module of the Qt Toolkit.
+**
+** $QT_BEGIN_LICENSE:GPL-EXCEPT$
+** Commercial License Usage
+** Licensees holding valid commercial Qt licenses may use this file in
+** accordance with the commercial license agreement provided with the
+** Software or, alternatively, in accordance with the terms contained in
+** a written agreement between you and The Qt Company. For licensing terms
+** and conditions see https://www.qt.io/terms-conditions. For further
+** information use the contact form at https://www.qt.io/contact-us.
+**
+** GNU General Public License Usage
+** Alternatively, this file may be used under the terms of the GNU
+** General Public License version 3 as published by the Free Software
+** Foundation with exceptions as appearing in the file LICENSE.GPL3-EXCEPT
+** included in the packaging of this file. Please review the following
+** information to ensure the GNU General Public License requirements will
+** be met: https://www.gnu.org/licenses/gpl-3.0.html.
+**
+** $QT_END_LICENSE$
+**
+****************************************************************************/
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"qtmoduleupdater/config"
+	"qtmoduleupdater/errs"
+)
+
+// UpdateSingleModule brings a single repository's dependencies.yaml up-to-date without requiring the
+// repo to be listed in the qt5 product supermodule. Unlike ModuleUpdateBatch it does not maintain a
+// todo/done schedule across modules; it resolves repoPath's declared dependencies directly, either
+// against the current HEADs of those dependency repos (productRef == "") or against the qt/qt5.git
+// product state at productRef. When dryRun is set the proposed dependencies.yaml diff and commit message
+// are printed to stdout instead of being pushed to Gerrit.
+func UpdateSingleModule(repoPath, branch, productRef, pushUserName string, manualStage, dryRun bool, cfg *config.Config) error {
+	done, err := resolveStandaloneDependencies(repoPath, branch, productRef, cfg)
+	if err != nil {
+		return fmt.Errorf("could not resolve dependencies for %s: %s", repoPath, err)
+	}
+
+	module, err := NewModule(repoPath, branch, map[string]*submodule{repoPath: {branch: branch}})
+	if err != nil {
+		return fmt.Errorf("could not create internal module structure for %s: %s", repoPath, err)
+	}
+
+	update, err := module.updateDependenciesForModule(done)
+	if err != nil {
+		return fmt.Errorf("error proposing module update for %s: %s", repoPath, err)
+	}
+
+	log.Printf("Attempting standalone update for module %s resulted in %v\n", repoPath, update.result)
+
+	switch update.result {
+	case DependenciesUpdateContentUpToDate:
+		fmt.Fprintf(os.Stdout, "%s is already up-to-date against %s\n", repoPath, standaloneRefDescription(productRef))
+		return nil
+	case DependenciesUpdateDependencyMissing:
+		return fmt.Errorf("%s has a dependency that could not be resolved against %s", repoPath, standaloneRefDescription(productRef))
+	case DependenciesUpdateUpdateScheduled:
+		if dryRun {
+			diff, diffErr := diffForCommit(repoPath, update.commitID)
+			if diffErr != nil {
+				return fmt.Errorf("could not produce dry-run diff for %s: %s", repoPath, diffErr)
+			}
+			fmt.Fprintf(os.Stdout, "--- dependencies.yaml diff for %s ---\n%s\n", repoPath, diff)
+			fmt.Fprintf(os.Stdout, "--- commit message ---\n%s\n", update.summary)
+			return nil
+		}
+
+		if err = pushChange(repoPath, branch, update.commitID, update.summary, pushUserName); err != nil {
+			return fmt.Errorf("error pushing change update for %s: %s", repoPath, err)
+		}
+
+		if !manualStage {
+			return reviewAndStageChange(repoPath, branch, update.commitID, update.summary, cfg.ReviewersFor(repoPath))
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid state returned by updateDependenciesForModule for %s", repoPath)
+	}
+}
+
+func standaloneRefDescription(productRef string) string {
+	if productRef == "" {
+		return "the current HEADs of its dependencies"
+	}
+	return fmt.Sprintf("qt/qt5.git at %s", productRef)
+}
+
+// resolveStandaloneDependencies builds the "done" module map used as the dependency resolution context
+// for a single standalone module, mirroring the role batch.Done plays in ModuleUpdateBatch.
+func resolveStandaloneDependencies(repoPath, branch, productRef string, cfg *config.Config) (map[string]*Module, error) {
+	if productRef != "" {
+		qt5Modules, err := getQt5ProductModules("qt/qt5", branch, productRef)
+		if err != nil {
+			return nil, fmt.Errorf("error listing qt5 product modules at %s: %s", productRef, err)
+		}
+
+		_, done, err := loadTodoAndDoneModuleMapFromSubModules(branch, qt5Modules, cfg)
+		return done, err
+	}
+
+	declared, err := declaredDependencyPaths(repoPath, branch, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]*Module)
+	for _, name := range declared {
+		depModule, err := NewModule(name, branch, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not create internal module structure for dependency %s: %s", name, err)
+		}
+		if err = depModule.refreshTip(); err != nil {
+			return nil, fmt.Errorf("could not resolve current HEAD for dependency %s: %s", name, err)
+		}
+		done[name] = depModule
+	}
+	return done, nil
+}
+
+// declaredDependencyPaths reads repoPath's dependencies.yaml as it currently exists on branch and
+// returns the repo paths it declares a dependency on. repoPath is a Gerrit project path (e.g.
+// "qt/qtbase"), not necessarily a local working directory, so the file is read directly from the
+// remote the same way getQt5ProductModules resolves qt5 product state, rather than assuming a
+// local clone.
+func declaredDependencyPaths(repoPath, branch string, cfg *config.Config) ([]string, error) {
+	raw, err := fetchRemoteFile(cfg.GerritURL, repoPath, branch, "dependencies.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("could not read dependencies.yaml from %s (%s): %s", repoPath, branch, err)
+	}
+
+	var parsed struct {
+		Dependencies map[string]struct {
+			Ref string `yaml:"ref"`
+		} `yaml:"dependencies"`
+	}
+	if err = yaml.Unmarshal(raw, &parsed); err != nil {
+		return nil, errs.New(
+			fmt.Sprintf("parse dependencies.yaml for %s", repoPath),
+			err,
+			fmt.Sprintf("check %s:dependencies.yaml for a YAML syntax error at the line the parser reported", branch),
+		)
+	}
+
+	paths := make([]string, 0, len(parsed.Dependencies))
+	for path := range parsed.Dependencies {
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// fetchRemoteFile reads path as it exists at ref in the Gerrit-hosted repo repoPath, without
+// requiring a local clone of that repo.
+func fetchRemoteFile(gerritURL, repoPath, ref, path string) ([]byte, error) {
+	remote := strings.TrimRight(gerritURL, "/") + "/" + repoPath
+	var archive bytes.Buffer
+	cmd := exec.Command("git", "archive", "--remote="+remote, ref, path)
+	cmd.Stdout = &archive
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not fetch %s from %s at %s: %s", path, remote, ref, err)
+	}
+
+	tarReader := tar.NewReader(&archive)
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, fmt.Errorf("remote archive for %s did not contain %s: %s", remote, path, err)
+	}
+
+	content := make([]byte, header.Size)
+	if _, err = io.ReadFull(tarReader, content); err != nil {
+		return nil, fmt.Errorf("could not read %s from remote archive for %s: %s", path, remote, err)
+	}
+	return content, nil
+}
+
+// diffForCommit returns the diff of commitID as committed locally in repoPath, for --dry-run display.
+func diffForCommit(repoPath, commitID string) (string, error) {
+	out, err := exec.Command("git", "-C", repoPath, "show", commitID).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}